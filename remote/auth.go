@@ -0,0 +1,135 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwt "github.com/coreos/flannel/Godeps/_workspace/src/github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errMissingAuthHeader   = errors.New("missing Authorization header")
+	errMalformedAuthHeader = errors.New("malformed Authorization header, expected 'Bearer <token>'")
+	errInvalidToken        = errors.New("invalid bearer token")
+)
+
+// Authenticator decides whether a request carrying a bearer token is
+// allowed to reach the remote subnet manager API.
+type Authenticator interface {
+	// Authenticate validates the bearer token and returns an error if
+	// the request should be rejected.
+	Authenticate(token string) error
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return "", errMissingAuthHeader
+	}
+
+	parts := strings.SplitN(h, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", errMalformedAuthHeader
+	}
+
+	return parts[1], nil
+}
+
+type staticTokenAuth struct {
+	tokens map[string]bool
+}
+
+// NewStaticTokenAuth returns an Authenticator that accepts any bearer
+// token present in tokens.
+func NewStaticTokenAuth(tokens []string) Authenticator {
+	a := &staticTokenAuth{tokens: make(map[string]bool, len(tokens))}
+	for _, t := range tokens {
+		a.tokens[t] = true
+	}
+	return a
+}
+
+func (a *staticTokenAuth) Authenticate(token string) error {
+	if !a.tokens[token] {
+		return errInvalidToken
+	}
+	return nil
+}
+
+type jwtAuth struct {
+	key []byte
+	alg string
+}
+
+// NewJWTAuth returns an Authenticator that accepts bearer tokens which
+// are valid JWTs signed with key using the given signing algorithm
+// (e.g. "HS256").
+func NewJWTAuth(key []byte, alg string) Authenticator {
+	return &jwtAuth{key: key, alg: alg}
+}
+
+func (a *jwtAuth) Authenticate(token string) error {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != a.alg {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Method.Alg())
+		}
+		return a.key, nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid bearer token: %v", err)
+	}
+	if !parsed.Valid {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// unauthenticatedPaths are exempt from authMiddleware even when auth is
+// configured, so that a standard Prometheus scrape config doesn't need
+// its own bearer token.
+var unauthenticatedPaths = map[string]bool{
+	"/metrics": true,
+}
+
+// authMiddleware wraps h so that every request must carry a bearer token
+// accepted by auth before being dispatched. A nil auth disables the
+// check entirely, preserving the historical unauthenticated behavior.
+func authMiddleware(auth Authenticator, h http.Handler) http.Handler {
+	if auth == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := bearerToken(r)
+		if err == nil {
+			err = auth.Authenticate(token)
+		}
+		if err != nil {
+			jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/coreos/flannel/Godeps/_workspace/src/github.com/golang/glog"
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "flannel",
+		Subsystem: "remote",
+		Name:      "requests_total",
+		Help:      "Total number of remote subnet manager API requests.",
+	}, []string{"handler", "network", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "flannel",
+		Subsystem: "remote",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of remote subnet manager API requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "network", "code"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "flannel",
+		Subsystem: "remote",
+		Name:      "requests_in_flight",
+		Help:      "Number of remote subnet manager API requests currently being served.",
+	}, []string{"handler", "network"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, requestsInFlight)
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code
+// written by the underlying handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Flush passes through to the underlying writer when it supports
+// flushing, so streaming handlers still work behind instrument.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// accessLogEntry is the structured access log line emitted for every
+// request, in place of the old ad-hoc glog line.
+type accessLogEntry struct {
+	Network    string `json:"network"`
+	Handler    string `json:"handler"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	ClientIP   string `json:"client_ip"`
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// maxMetricNetworks bounds how many distinct "network" label values the
+// Prometheus metrics below will track.
+const maxMetricNetworks = 100
+
+var (
+	metricNetworksMu sync.Mutex
+	metricNetworks   = make(map[string]bool)
+)
+
+// metricNetworkLabel bounds the cardinality of the "network" label on
+// requestsTotal/requestDuration/requestsInFlight: the network path
+// segment is caller-controlled, so without a cap a client (or, with no
+// auth configured, anyone who can reach the listener) could mint
+// unbounded label values and blow up the metrics' series count. The
+// structured access log still records the real network unconditionally.
+func metricNetworkLabel(network string) string {
+	metricNetworksMu.Lock()
+	defer metricNetworksMu.Unlock()
+
+	if metricNetworks[network] {
+		return network
+	}
+	if len(metricNetworks) >= maxMetricNetworks {
+		return "other"
+	}
+	metricNetworks[network] = true
+	return network
+}
+
+// instrument wraps h so that every request records Prometheus metrics
+// (request count, latency, in-flight gauge) and emits a structured JSON
+// access log line, all labeled with the logical handler name.
+func instrument(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		network := mux.Vars(r)["network"]
+		if network == "_" {
+			network = ""
+		}
+
+		metricNetwork := metricNetworkLabel(network)
+
+		requestsInFlight.WithLabelValues(name, metricNetwork).Inc()
+		defer requestsInFlight.WithLabelValues(name, metricNetwork).Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h(rec, r)
+		duration := time.Since(start)
+
+		code := strconv.Itoa(rec.status)
+		requestsTotal.WithLabelValues(name, metricNetwork, code).Inc()
+		requestDuration.WithLabelValues(name, metricNetwork, code).Observe(duration.Seconds())
+
+		entry := accessLogEntry{
+			Network:    network,
+			Handler:    name,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     rec.status,
+			DurationMs: duration.Nanoseconds() / int64(time.Millisecond),
+			ClientIP:   clientIP(r),
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Errorf("Error JSON encoding access log entry: %v", err)
+			return
+		}
+		log.Info(string(data))
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestMetricNetworkLabelCardinalityCap guards the bound on the "network"
+// Prometheus label: once maxMetricNetworks distinct networks have been
+// seen, anything new must collapse to "other" instead of minting another
+// label value, while networks registered before the cap was hit keep
+// their own label.
+func TestMetricNetworkLabelCardinalityCap(t *testing.T) {
+	// Use a prefix unique to this test so it doesn't collide with label
+	// values any other test in the package might register.
+	const prefix = "cardinality-test-network-"
+
+	for i := 0; i < maxMetricNetworks; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if got := metricNetworkLabel(name); got != name {
+			t.Fatalf("metricNetworkLabel(%q) = %q, want %q (should still fit under the cap)", name, got, name)
+		}
+	}
+
+	overflow := fmt.Sprintf("%soverflow", prefix)
+	if got := metricNetworkLabel(overflow); got != "other" {
+		t.Fatalf("metricNetworkLabel(%q) past the cap = %q, want %q", overflow, got, "other")
+	}
+
+	// A second never-before-seen network also collapses, not just the first.
+	overflow2 := fmt.Sprintf("%soverflow2", prefix)
+	if got := metricNetworkLabel(overflow2); got != "other" {
+		t.Fatalf("metricNetworkLabel(%q) past the cap = %q, want %q", overflow2, got, "other")
+	}
+
+	// Networks registered before the cap was hit are unaffected and keep
+	// their own label.
+	stable := fmt.Sprintf("%s0", prefix)
+	if got := metricNetworkLabel(stable); got != stable {
+		t.Fatalf("metricNetworkLabel(%q) for a previously registered network = %q, want it to stay %q", stable, got, stable)
+	}
+}
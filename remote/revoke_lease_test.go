@@ -0,0 +1,110 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/coreos/flannel/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/flannel/subnet"
+)
+
+// fakeManager is a minimal subnet.Manager stand-in for handler tests: it
+// embeds the real interface (unset) so it satisfies subnet.Manager
+// through method promotion, and only overrides the methods a given test
+// actually exercises.
+type fakeManager struct {
+	subnet.Manager
+
+	revokeCalls []fakeRevokeCall
+	revokeErr   error
+
+	watchLeaseResult *subnet.WatchResult
+	watchLeaseErr    error
+}
+
+type fakeRevokeCall struct {
+	network string
+	sn      *net.IPNet
+}
+
+func (m *fakeManager) RevokeLease(ctx context.Context, network string, sn *net.IPNet) error {
+	m.revokeCalls = append(m.revokeCalls, fakeRevokeCall{network, sn})
+	return m.revokeErr
+}
+
+func TestHandleRevokeLease(t *testing.T) {
+	newRouter := func(sm subnet.Manager) *mux.Router {
+		router := mux.NewRouter()
+		router.HandleFunc("/{network}/leases/{subnet}", func(w http.ResponseWriter, r *http.Request) {
+			handleRevokeLease(context.Background(), sm, w, r)
+		}).Methods("DELETE")
+		return router
+	}
+
+	t.Run("invalid subnet key returns 400 without touching the manager", func(t *testing.T) {
+		// A nil subnet.Manager proves the handler returns before ever
+		// dispatching to it: ParseSubnetKey must fail first.
+		router := newRouter(nil)
+
+		req := httptest.NewRequest("DELETE", "/mynet/leases/not-a-subnet", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	})
+
+	t.Run("manager error surfaces as 500", func(t *testing.T) {
+		sm := &fakeManager{revokeErr: errors.New("backend unavailable")}
+		router := newRouter(sm)
+
+		req := httptest.NewRequest("DELETE", "/mynet/leases/10.1.2.0-24", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusInternalServerError, rec.Body.String())
+		}
+	})
+
+	t.Run("success revokes the parsed subnet on the right network", func(t *testing.T) {
+		sm := &fakeManager{}
+		router := newRouter(sm)
+
+		req := httptest.NewRequest("DELETE", "/mynet/leases/10.1.2.0-24", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if len(sm.revokeCalls) != 1 {
+			t.Fatalf("RevokeLease was called %d times, want 1", len(sm.revokeCalls))
+		}
+		if sm.revokeCalls[0].network != "mynet" {
+			t.Fatalf("RevokeLease called with network %q, want %q", sm.revokeCalls[0].network, "mynet")
+		}
+		if sn := sm.revokeCalls[0].sn; sn == nil || sn.String() != "10.1.2.0/24" {
+			t.Fatalf("RevokeLease called with subnet %v, want %v", sn, "10.1.2.0/24")
+		}
+	})
+}
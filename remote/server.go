@@ -15,15 +15,20 @@
 package remote
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	log "github.com/coreos/flannel/Godeps/_workspace/src/github.com/golang/glog"
 	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/coreos/flannel/Godeps/_workspace/src/golang.org/x/net/context"
 
 	"github.com/coreos/flannel/subnet"
@@ -109,6 +114,31 @@ func handleRenewLease(ctx context.Context, sm subnet.Manager, w http.ResponseWri
 	jsonResponse(w, http.StatusOK, lease)
 }
 
+// DELETE /{network}/leases/{subnet}
+func handleRevokeLease(ctx context.Context, sm subnet.Manager, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	network := mux.Vars(r)["network"]
+	if network == "_" {
+		network = ""
+	}
+
+	sn, err := subnet.ParseSubnetKey(mux.Vars(r)["subnet"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "invalid subnet: ", err)
+		return
+	}
+
+	if err := sm.RevokeLease(ctx, network, sn); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func getCursor(u *url.URL) (interface{}, error) {
 	vals, ok := u.Query()["next"]
 	if !ok {
@@ -118,7 +148,136 @@ func getCursor(u *url.URL) (interface{}, error) {
 	return index, err
 }
 
-// GET /{network}/leases?next=cursor
+// getWait parses the optional ?wait=<duration> query parameter used to
+// long-poll a watch endpoint, e.g. "?wait=30s".
+func getWait(u *url.URL) (time.Duration, error) {
+	vals, ok := u.Query()["wait"]
+	if !ok {
+		return 0, nil
+	}
+	return time.ParseDuration(vals[0])
+}
+
+func isEventStream(r *http.Request) bool {
+	return r.Header.Get("Accept") == "text/event-stream"
+}
+
+// watchFetchFunc fetches the next batch of events past cursor, blocking
+// (subject to ctx's deadline) until one is available.
+type watchFetchFunc func(ctx context.Context, cursor interface{}) (*subnet.WatchResult, error)
+
+// mergeContext returns a context that is done when either reqCtx (the
+// request's own context, cancelled when the client disconnects) or
+// serverCtx (the process-lifetime context passed to RunServerTLS,
+// cancelled on shutdown) is done, whichever comes first.
+func mergeContext(reqCtx, serverCtx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(reqCtx)
+	go func() {
+		select {
+		case <-serverCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
+
+// serveWatch drives a single long-poll fetch, or, for clients that sent
+// "Accept: text/event-stream", an indefinite SSE stream of fetches. It is
+// shared by handleWatchLeases and handleWatchLease. Fetches are bound to
+// the request's own context so that a client disconnecting mid-poll or
+// mid-stream stops the underlying backend watch instead of leaking it
+// for the life of the process.
+func serveWatch(ctx context.Context, w http.ResponseWriter, r *http.Request, cursor interface{}, fetch watchFetchFunc) {
+	wait, err := getWait(r.URL)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "invalid 'wait' value: ", err)
+		return
+	}
+
+	base := mergeContext(r.Context(), ctx)
+
+	if isEventStream(r) {
+		streamWatch(base, w, cursor, fetch)
+		return
+	}
+
+	wctx := base
+	if wait > 0 {
+		var cancel context.CancelFunc
+		wctx, cancel = context.WithTimeout(base, wait)
+		defer cancel()
+	}
+
+	wr, err := fetch(wctx, cursor)
+	if err != nil {
+		if wctx.Err() != nil {
+			// The long-poll timer expired with nothing new to report;
+			// hand back an empty result at the same cursor rather than
+			// an error so clients can simply loop.
+			jsonResponse(w, http.StatusOK, &subnet.WatchResult{Cursor: cursor})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	normalizeCursor(wr)
+	jsonResponse(w, http.StatusOK, wr)
+}
+
+// streamWatch upgrades the response to a Server-Sent Events stream,
+// flushing a WatchResult as soon as each fetch returns and then blocking
+// on the next one, until the client disconnects or ctx is cancelled.
+func streamWatch(ctx context.Context, w http.ResponseWriter, cursor interface{}, fetch watchFetchFunc) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "streaming not supported")
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		wr, err := fetch(ctx, cursor)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+			flusher.Flush()
+			return
+		}
+
+		// Keep the backend-native cursor for the next fetch; normalizeCursor
+		// below only stringifies the copy going out over the wire.
+		next := wr.Cursor
+		normalizeCursor(wr)
+
+		data, err := json.Marshal(wr)
+		if err != nil {
+			log.Errorf("Error JSON encoding SSE event: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		cursor = next
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// GET /{network}/leases?next=cursor[&wait=duration]
 func handleWatchLeases(ctx context.Context, sm subnet.Manager, w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -134,42 +293,167 @@ func handleWatchLeases(ctx context.Context, sm subnet.Manager, w http.ResponseWr
 		return
 	}
 
-	wr, err := sm.WatchLeases(ctx, network, cursor)
+	serveWatch(ctx, w, r, cursor, func(ctx context.Context, cursor interface{}) (*subnet.WatchResult, error) {
+		return sm.WatchLeases(ctx, network, cursor)
+	})
+}
+
+// GET /{network}/leases/{subnet}?next=cursor[&wait=duration]
+func handleWatchLease(ctx context.Context, sm subnet.Manager, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	network := mux.Vars(r)["network"]
+	if network == "_" {
+		network = ""
+	}
+
+	sn, err := subnet.ParseSubnetKey(mux.Vars(r)["subnet"])
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "invalid subnet: ", err)
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, wr)
+	cursor, err := getCursor(r.URL)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "invalid 'next' value: ", err)
+		return
+	}
+
+	serveWatch(ctx, w, r, cursor, func(ctx context.Context, cursor interface{}) (*subnet.WatchResult, error) {
+		return sm.WatchLease(ctx, network, sn, cursor)
+	})
+}
+
+// normalizeCursor rewrites wr.Cursor to its string form when the backend
+// hands back a fmt.Stringer (e.g. an etcd mod index wrapper), so clients
+// never need to know backend-specific cursor types. Cursors of any other
+// type are left as they are.
+func normalizeCursor(wr *subnet.WatchResult) {
+	if s, ok := wr.Cursor.(fmt.Stringer); ok {
+		wr.Cursor = s.String()
+	}
 }
 
-func bindHandler(h handler, ctx context.Context, sm subnet.Manager) http.HandlerFunc {
+// bindHandler adapts h into an http.HandlerFunc bound to ctx and sm, and
+// wraps it with Prometheus metrics and structured access logging labeled
+// with the logical handler name (e.g. "acquire", "watch").
+func bindHandler(name string, h handler, ctx context.Context, sm subnet.Manager) http.HandlerFunc {
 	return func(resp http.ResponseWriter, req *http.Request) {
-		h(ctx, sm, resp, req)
+		instrument(name, func(w http.ResponseWriter, r *http.Request) {
+			h(ctx, sm, w, r)
+		})(resp, req)
 	}
 }
 
+// ServerConfig holds the listener options for RunServerTLS. A zero value
+// serves plain HTTP, matching the historical behavior of RunServer.
+type ServerConfig struct {
+	// ListenAddr is the address RunServerTLS listens on, e.g. ":8080".
+	ListenAddr string
+
+	// TLSCertFile and TLSKeyFile, if both set, cause the listener to
+	// terminate TLS using this server certificate/key pair.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ClientCAFile, if set, enables mutual TLS: only clients presenting
+	// a certificate signed by this CA bundle are accepted.
+	ClientCAFile string
+
+	// MinTLSVersion is the minimum accepted TLS version, e.g.
+	// tls.VersionTLS12. Defaults to tls.VersionTLS12 when zero.
+	MinTLSVersion uint16
+
+	// Auth, if set, is consulted on every request; requests whose
+	// bearer token it rejects never reach the mux.
+	Auth Authenticator
+}
+
+func (c *ServerConfig) tlsEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
+}
+
+func (c *ServerConfig) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading server cert/key: %v", err)
+	}
+
+	minVersion := c.MinTLSVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %v", c.ClientCAFile)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// RunServer serves the remote subnet manager API as plain, unencrypted
+// HTTP. It is kept for backward compatibility; new callers that need TLS
+// or mTLS should use RunServerTLS.
 func RunServer(ctx context.Context, sm subnet.Manager, listenAddr string) {
+	RunServerTLS(ctx, sm, ServerConfig{ListenAddr: listenAddr})
+}
+
+// RunServerTLS serves the remote subnet manager API per cfg. When cfg
+// sets TLSCertFile or TLSKeyFile, the listener terminates TLS (and, with
+// ClientCAFile set, requires and verifies client certificates); if the
+// TLS configuration cannot be loaded, it logs the error and returns
+// without serving. With neither file set it serves plain HTTP.
+func RunServerTLS(ctx context.Context, sm subnet.Manager, cfg ServerConfig) {
 	// {network} is always required a the API level but to
 	// keep backward compat, special "_" network is allowed
 	// that means "no network"
 
 	r := mux.NewRouter()
-	r.HandleFunc("/{network}/config", bindHandler(handleGetNetworkConfig, ctx, sm)).Methods("GET")
-	r.HandleFunc("/{network}/leases", bindHandler(handleAcquireLease, ctx, sm)).Methods("POST")
-	r.HandleFunc("/{network}/leases/{subnet}", bindHandler(handleRenewLease, ctx, sm)).Methods("PUT")
-	r.HandleFunc("/{network}/leases", bindHandler(handleWatchLeases, ctx, sm)).Methods("GET")
-
-	l, err := net.Listen("tcp", listenAddr)
+	r.HandleFunc("/{network}/config", bindHandler("config", handleGetNetworkConfig, ctx, sm)).Methods("GET")
+	r.HandleFunc("/{network}/leases", bindHandler("acquire", handleAcquireLease, ctx, sm)).Methods("POST")
+	r.HandleFunc("/{network}/leases/{subnet}", bindHandler("renew", handleRenewLease, ctx, sm)).Methods("PUT")
+	r.HandleFunc("/{network}/leases/{subnet}", bindHandler("revoke", handleRevokeLease, ctx, sm)).Methods("DELETE")
+	r.HandleFunc("/{network}/leases/{subnet}", bindHandler("watch", handleWatchLease, ctx, sm)).Methods("GET")
+	r.HandleFunc("/{network}/leases", bindHandler("watch", handleWatchLeases, ctx, sm)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	l, err := net.Listen("tcp", cfg.ListenAddr)
 	if err != nil {
-		log.Errorf("Error listening on %v: %v", listenAddr, err)
+		log.Errorf("Error listening on %v: %v", cfg.ListenAddr, err)
 		return
 	}
 
+	if cfg.tlsEnabled() {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			log.Errorf("Error configuring TLS: %v", err)
+			l.Close()
+			return
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+
 	c := make(chan error, 1)
 	go func() {
-		c <- http.Serve(l, httpLogger(r))
+		c <- http.Serve(l, authMiddleware(cfg.Auth, r))
 	}()
 
 	select {
@@ -178,6 +462,6 @@ func RunServer(ctx context.Context, sm subnet.Manager, listenAddr string) {
 		<-c
 
 	case err := <-c:
-		log.Errorf("Error serving on %v: %v", listenAddr, err)
+		log.Errorf("Error serving on %v: %v", cfg.ListenAddr, err)
 	}
 }
@@ -0,0 +1,168 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert generates a throwaway self-signed cert/key pair and
+// writes them (PEM-encoded) under dir, returning their paths.
+func writeTestCert(t *testing.T, dir, prefix string) (certPath, keyPath string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: prefix},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:         true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	certPath = filepath.Join(dir, prefix+"-cert.pem")
+	keyPath = filepath.Join(dir, prefix+"-key.pem")
+
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		t.Fatalf("failed to create %v: %v", certPath, err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("failed to write %v: %v", certPath, err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyOut, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatalf("failed to create %v: %v", keyPath, err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		t.Fatalf("failed to write %v: %v", keyPath, err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestServerConfigTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flannel-remote-tls-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certPath, keyPath := writeTestCert(t, dir, "server")
+	caCertPath, _ := writeTestCert(t, dir, "ca")
+
+	t.Run("cert and key only", func(t *testing.T) {
+		cfg := &ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath}
+
+		tlsCfg, err := cfg.tlsConfig()
+		if err != nil {
+			t.Fatalf("tlsConfig() error = %v", err)
+		}
+		if len(tlsCfg.Certificates) != 1 {
+			t.Fatalf("got %d certificates, want 1", len(tlsCfg.Certificates))
+		}
+		if tlsCfg.MinVersion != tls.VersionTLS12 {
+			t.Fatalf("got MinVersion %v, want default of %v", tlsCfg.MinVersion, tls.VersionTLS12)
+		}
+		if tlsCfg.ClientAuth != tls.NoClientCert {
+			t.Fatalf("got ClientAuth %v, want %v (no ClientCAFile configured)", tlsCfg.ClientAuth, tls.NoClientCert)
+		}
+	})
+
+	t.Run("custom minimum TLS version", func(t *testing.T) {
+		cfg := &ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath, MinTLSVersion: tls.VersionTLS13}
+
+		tlsCfg, err := cfg.tlsConfig()
+		if err != nil {
+			t.Fatalf("tlsConfig() error = %v", err)
+		}
+		if tlsCfg.MinVersion != tls.VersionTLS13 {
+			t.Fatalf("got MinVersion %v, want %v", tlsCfg.MinVersion, tls.VersionTLS13)
+		}
+	})
+
+	t.Run("with client CA enables mutual TLS", func(t *testing.T) {
+		cfg := &ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath, ClientCAFile: caCertPath}
+
+		tlsCfg, err := cfg.tlsConfig()
+		if err != nil {
+			t.Fatalf("tlsConfig() error = %v", err)
+		}
+		if tlsCfg.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Fatalf("got ClientAuth %v, want %v", tlsCfg.ClientAuth, tls.RequireAndVerifyClientCert)
+		}
+		if tlsCfg.ClientCAs == nil {
+			t.Fatalf("expected ClientCAs pool to be set")
+		}
+	})
+
+	t.Run("missing client CA file errors", func(t *testing.T) {
+		cfg := &ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath, ClientCAFile: filepath.Join(dir, "does-not-exist.pem")}
+
+		if _, err := cfg.tlsConfig(); err == nil {
+			t.Fatalf("expected error for missing client CA file, got nil")
+		}
+	})
+
+	t.Run("malformed client CA file errors", func(t *testing.T) {
+		badCA := filepath.Join(dir, "bad-ca.pem")
+		if err := ioutil.WriteFile(badCA, []byte("not a pem file"), 0644); err != nil {
+			t.Fatalf("failed to write %v: %v", badCA, err)
+		}
+
+		cfg := &ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath, ClientCAFile: badCA}
+
+		if _, err := cfg.tlsConfig(); err == nil {
+			t.Fatalf("expected error for malformed client CA file, got nil")
+		}
+	})
+
+	t.Run("missing server cert/key errors", func(t *testing.T) {
+		cfg := &ServerConfig{TLSCertFile: filepath.Join(dir, "missing-cert.pem"), TLSKeyFile: filepath.Join(dir, "missing-key.pem")}
+
+		if _, err := cfg.tlsConfig(); err == nil {
+			t.Fatalf("expected error for missing server cert/key, got nil")
+		}
+	})
+}
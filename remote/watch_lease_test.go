@@ -0,0 +1,90 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/coreos/flannel/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/flannel/subnet"
+)
+
+func (m *fakeManager) WatchLease(ctx context.Context, network string, sn *net.IPNet, cursor interface{}) (*subnet.WatchResult, error) {
+	return m.watchLeaseResult, m.watchLeaseErr
+}
+
+func TestHandleWatchLease(t *testing.T) {
+	newRouter := func(sm subnet.Manager) *mux.Router {
+		router := mux.NewRouter()
+		router.HandleFunc("/{network}/leases/{subnet}", func(w http.ResponseWriter, r *http.Request) {
+			handleWatchLease(context.Background(), sm, w, r)
+		}).Methods("GET")
+		return router
+	}
+
+	t.Run("invalid subnet key returns 400 without touching the manager", func(t *testing.T) {
+		// A nil subnet.Manager proves the handler returns before ever
+		// dispatching to it: ParseSubnetKey must fail first.
+		router := newRouter(nil)
+
+		req := httptest.NewRequest("GET", "/mynet/leases/not-a-subnet", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	})
+
+	t.Run("manager error surfaces as 500", func(t *testing.T) {
+		sm := &fakeManager{watchLeaseErr: errors.New("backend unavailable")}
+		router := newRouter(sm)
+
+		req := httptest.NewRequest("GET", "/mynet/leases/10.1.2.0-24", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusInternalServerError, rec.Body.String())
+		}
+	})
+
+	t.Run("success returns the watch result", func(t *testing.T) {
+		sm := &fakeManager{watchLeaseResult: &subnet.WatchResult{Cursor: "7"}}
+		router := newRouter(sm)
+
+		req := httptest.NewRequest("GET", "/mynet/leases/10.1.2.0-24", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var wr subnet.WatchResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &wr); err != nil {
+			t.Fatalf("failed to decode response body: %v", err)
+		}
+		if wr.Cursor != "7" {
+			t.Fatalf("got cursor %v, want %q", wr.Cursor, "7")
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/flannel/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/flannel/subnet"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", raw, err)
+	}
+	return u
+}
+
+func TestGetCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "absent", raw: "/foo/leases", want: nil},
+		{name: "valid", raw: "/foo/leases?next=42", want: uint64(42)},
+		{name: "not a number", raw: "/foo/leases?next=abc", wantErr: true},
+		{name: "negative", raw: "/foo/leases?next=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getCursor(mustParseURL(t, tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("getCursor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "absent", raw: "/foo/leases", want: 0},
+		{name: "seconds", raw: "/foo/leases?wait=30s", want: 30 * time.Second},
+		{name: "minutes", raw: "/foo/leases?wait=2m", want: 2 * time.Minute},
+		{name: "invalid", raw: "/foo/leases?wait=not-a-duration", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getWait(mustParseURL(t, tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getWait() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("getWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type stringerCursor struct{ s string }
+
+func (c stringerCursor) String() string { return c.s }
+
+func TestNormalizeCursor(t *testing.T) {
+	t.Run("plain string is untouched", func(t *testing.T) {
+		wr := &subnet.WatchResult{Cursor: "already-a-string"}
+		normalizeCursor(wr)
+		if wr.Cursor != "already-a-string" {
+			t.Fatalf("got %v, want unchanged string", wr.Cursor)
+		}
+	})
+
+	t.Run("fmt.Stringer is rewritten to its string form", func(t *testing.T) {
+		wr := &subnet.WatchResult{Cursor: stringerCursor{s: "42"}}
+		normalizeCursor(wr)
+		if wr.Cursor != "42" {
+			t.Fatalf("got %v (%T), want %q", wr.Cursor, wr.Cursor, "42")
+		}
+	})
+
+	t.Run("nil cursor is untouched", func(t *testing.T) {
+		wr := &subnet.WatchResult{Cursor: nil}
+		normalizeCursor(wr)
+		if wr.Cursor != nil {
+			t.Fatalf("got %v, want nil", wr.Cursor)
+		}
+	})
+
+	t.Run("non-stringer type is untouched", func(t *testing.T) {
+		wr := &subnet.WatchResult{Cursor: uint64(7)}
+		normalizeCursor(wr)
+		if wr.Cursor != uint64(7) {
+			t.Fatalf("got %v (%T), want unchanged uint64(7)", wr.Cursor, wr.Cursor)
+		}
+	})
+}
+
+// TestStreamWatchKeepsNativeCursorAcrossFetches guards against
+// normalizeCursor's string rewrite leaking into the cursor handed to the
+// *next* fetch call: only the JSON-encoded copy sent to the client
+// should ever be stringified.
+func TestStreamWatchKeepsNativeCursorAcrossFetches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var gotCursors []interface{}
+	calls := 0
+	fetch := func(ctx context.Context, cursor interface{}) (*subnet.WatchResult, error) {
+		gotCursors = append(gotCursors, cursor)
+		calls++
+		if calls >= 2 {
+			cancel()
+		}
+		return &subnet.WatchResult{Cursor: stringerCursor{s: fmt.Sprintf("%d", calls)}}, nil
+	}
+
+	streamWatch(ctx, httptest.NewRecorder(), nil, fetch)
+
+	if len(gotCursors) < 2 {
+		t.Fatalf("fetch was called %d times, want at least 2", len(gotCursors))
+	}
+	if _, ok := gotCursors[1].(stringerCursor); !ok {
+		t.Fatalf("second fetch got cursor %v (%T), want the backend-native stringerCursor from the first response, not its stringified form", gotCursors[1], gotCursors[1])
+	}
+}